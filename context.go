@@ -0,0 +1,68 @@
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+package lhm // import "github.com/mjolnir42/lhm"
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/mjolnir42/lhm/ctxlog"
+	"github.com/sirupsen/logrus"
+)
+
+// WithContext looks up the logger registered as key and returns a
+// logrus.Entry for it with the correlation id, trace id and user id
+// carried by ctx (via the lhm/ctxlog helpers) attached as fields.
+// Identifiers not present in ctx are simply omitted. If key is not
+// registered, nil is returned.
+func (x *LogHandleMap) WithContext(ctx context.Context, key string) *logrus.Entry {
+	lg := x.GetLogger(key)
+	if lg == nil {
+		return nil
+	}
+	return lg.WithFields(ctxlog.Fields(ctx))
+}
+
+// hostPIDHook enriches every entry fired by the loggers it is
+// attached to with the local hostname and the current process id, so
+// loggers returned by LogHandleMap are already wired for correlation
+// across hosts and processes without callers remembering to call
+// WithField at each site.
+type hostPIDHook struct {
+	hostname string
+	pid      int
+}
+
+// newHostPIDHook builds a hostPIDHook, resolving the local hostname
+// once at construction time.
+func newHostPIDHook() *hostPIDHook {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = `unknown`
+	}
+	return &hostPIDHook{
+		hostname: hostname,
+		pid:      os.Getpid(),
+	}
+}
+
+// Levels implements logrus.Hook and fires for every level.
+func (h *hostPIDHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook and attaches the hostname and pid
+// fields to entry.
+func (h *hostPIDHook) Fire(entry *logrus.Entry) error {
+	entry.Data[`hostname`] = h.hostname
+	entry.Data[`pid`] = strconv.Itoa(h.pid)
+	return nil
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
@@ -0,0 +1,90 @@
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+// Package ctxlog provides well-known context.Context keys for
+// threading correlation, trace and user identifiers through to the
+// loggers managed by lhm.LogHandleMap.
+package ctxlog // import "github.com/mjolnir42/lhm/ctxlog"
+
+import (
+	"context"
+)
+
+// ctxKey is an unexported type for the context keys defined below,
+// so values set by this package cannot collide with keys set by
+// other packages.
+type ctxKey int
+
+const (
+	correlationIDKey ctxKey = iota
+	traceIDKey
+	userIDKey
+)
+
+// FieldCorrelationID, FieldTraceID and FieldUserID are the logrus
+// field names used by lhm.LogHandleMap.WithContext for the values
+// carried in a context.Context by this package.
+const (
+	FieldCorrelationID = `correlation_id`
+	FieldTraceID       = `trace_id`
+	FieldUserID        = `user_id`
+)
+
+// InjectCorrelationID returns a copy of ctx carrying id as its
+// correlation id.
+func InjectCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// CorrelationIDFromContext returns the correlation id stored in ctx,
+// if any.
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(correlationIDKey).(string)
+	return id, ok
+}
+
+// InjectTraceID returns a copy of ctx carrying id as its trace id.
+func InjectTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey, id)
+}
+
+// TraceIDFromContext returns the trace id stored in ctx, if any.
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(traceIDKey).(string)
+	return id, ok
+}
+
+// InjectUserID returns a copy of ctx carrying id as its user id.
+func InjectUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
+// UserIDFromContext returns the user id stored in ctx, if any.
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(userIDKey).(string)
+	return id, ok
+}
+
+// Fields extracts every well-known identifier present in ctx and
+// returns them as a logrus-compatible field map, keyed by
+// FieldCorrelationID, FieldTraceID and FieldUserID. Identifiers that
+// are not set in ctx are omitted.
+func Fields(ctx context.Context) map[string]interface{} {
+	f := map[string]interface{}{}
+	if id, ok := CorrelationIDFromContext(ctx); ok {
+		f[FieldCorrelationID] = id
+	}
+	if id, ok := TraceIDFromContext(ctx); ok {
+		f[FieldTraceID] = id
+	}
+	if id, ok := UserIDFromContext(ctx); ok {
+		f[FieldUserID] = id
+	}
+	return f
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
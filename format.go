@@ -0,0 +1,120 @@
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+package lhm // import "github.com/mjolnir42/lhm"
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Formatter selects one of the built-in logrus formatters for a
+// logger opened via OpenWith.
+type Formatter int
+
+const (
+	// FormatText renders log entries as human-readable text, the
+	// historical default used by Open.
+	FormatText Formatter = iota
+	// FormatJSON renders log entries as newline-delimited JSON,
+	// suitable for log-shipping pipelines such as ELK, Loki or
+	// GCP Logging.
+	FormatJSON
+)
+
+// openConfig collects the settings applied by the Option functions
+// passed to OpenWith.
+type openConfig struct {
+	formatter     logrus.Formatter
+	reportCaller  bool
+	defaultFields logrus.Fields
+}
+
+// Option configures a logger opened via OpenWith.
+type Option func(*openConfig)
+
+// WithFormatter selects one of the built-in Formatter kinds.
+func WithFormatter(f Formatter) Option {
+	return func(c *openConfig) {
+		switch f {
+		case FormatJSON:
+			c.formatter = &logrus.JSONFormatter{}
+		default:
+			c.formatter = &logrus.TextFormatter{
+				DisableColors: true,
+				FullTimestamp: true,
+			}
+		}
+	}
+}
+
+// WithCustomFormatter sets an arbitrary logrus.Formatter, overriding
+// any Formatter kind selected via an earlier WithFormatter; a
+// WithFormatter passed after it overrides it in turn.
+func WithCustomFormatter(f logrus.Formatter) Option {
+	return func(c *openConfig) {
+		c.formatter = f
+	}
+}
+
+// WithReportCaller enables or disables logrus' ReportCaller on the
+// opened logger.
+func WithReportCaller(report bool) Option {
+	return func(c *openConfig) {
+		c.reportCaller = report
+	}
+}
+
+// WithDefaultFields merges fields into every entry written by the
+// opened logger.
+func WithDefaultFields(fields map[string]interface{}) Option {
+	return func(c *openConfig) {
+		if c.defaultFields == nil {
+			c.defaultFields = logrus.Fields{}
+		}
+		for k, v := range fields {
+			c.defaultFields[k] = v
+		}
+	}
+}
+
+// defaultFieldsHook merges a fixed set of fields into every entry
+// fired by the logger it is attached to, so a default-fields
+// configuration applies uniformly and not just to the "logfile
+// started" marker entry.
+type defaultFieldsHook struct {
+	fields logrus.Fields
+}
+
+// Levels implements logrus.Hook and fires for every level.
+func (h *defaultFieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook and merges the configured default
+// fields into entry, without overwriting fields already set by the
+// caller.
+func (h *defaultFieldsHook) Fire(entry *logrus.Entry) error {
+	for k, v := range h.fields {
+		if _, ok := entry.Data[k]; !ok {
+			entry.Data[k] = v
+		}
+	}
+	return nil
+}
+
+// SetDefaultFormatter sets the formatter newly opened loggers fall
+// back to when OpenWith is not given a WithFormatter/WithCustomFormatter
+// option, and updates the `__early` logger created by Init() in place
+// so it immediately reflects the new formatter.
+func (x *LogHandleMap) SetDefaultFormatter(f logrus.Formatter) {
+	x.Lock()
+	defer x.Unlock()
+	x.defaultFormatter = f
+	if nl, ok := x.lmap[`__early`]; ok {
+		nl.Formatter = f
+	}
+}
@@ -0,0 +1,126 @@
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+package lhm // import "github.com/mjolnir42/lhm"
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxForwarderLineBytes caps the line length OpenForwarder's scanner
+// accepts, so a misbehaving child process writing an unterminated
+// stream cannot grow memory without bound.
+const maxForwarderLineBytes = 1 << 20 // 1 MiB
+
+// forwarderRecord is the newline-delimited JSON shape OpenForwarder
+// expects a child process to emit on the pipe, following the
+// runc/libcontainer logs.go convention.
+type forwarderRecord struct {
+	Level  string                 `json:"level"`
+	Msg    string                 `json:"msg"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// forwarder tracks the read end of a pipe opened by OpenForwarder, so
+// Del/shutdown can close it and let the scanning goroutine drain and
+// exit.
+type forwarder struct {
+	r *os.File
+}
+
+// OpenForwarder creates an os.Pipe and registers the read end with a
+// goroutine that scans newline-delimited JSON records
+// (`{"level":"info","msg":"...","fields":{...}}`) off it and
+// re-emits them through the logrus logger registered as key, at the
+// level decoded from each record. Unknown or missing levels fall
+// back to lvl. The write end is returned for the caller to hand to
+// exec.Cmd.ExtraFiles or as Stderr. On Del(key) the pipe is closed
+// and the goroutine drains whatever records are already buffered
+// before exiting. Calling OpenForwarder again for a key that already
+// has one closes the previous read end first, so respawning the
+// forwarded subprocess does not leak the old pipe/goroutine.
+func (x *LogHandleMap) OpenForwarder(key string, lvl logrus.Level) (*os.File, error) {
+	lg := x.GetLogger(key)
+	if lg == nil {
+		return nil, fmt.Errorf("lhm: OpenForwarder: no logger registered for key `%s`", key)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	x.Lock()
+	if x.forwarders == nil {
+		x.forwarders = make(map[string]*forwarder)
+	}
+	if old, ok := x.forwarders[key]; ok {
+		old.r.Close()
+	}
+	x.forwarders[key] = &forwarder{r: r}
+	x.Unlock()
+
+	go runForwarder(r, lg, lvl)
+	return w, nil
+}
+
+// runForwarder scans newline-delimited JSON records off r and
+// re-emits them through lg, falling back to lvl for malformed lines
+// or records missing a known level. It returns once r is closed and
+// drained. A single line over maxForwarderLineBytes does not kill
+// forwarding: it is reported through lg, the bytes of it already
+// buffered are dropped, and scanning resumes right after them, so
+// the rest of that line is forwarded as a line of its own.
+func runForwarder(r *os.File, lg *logrus.Logger, lvl logrus.Level) {
+	defer r.Close()
+
+	for {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 64*1024), maxForwarderLineBytes)
+
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var rec forwarderRecord
+			if err := json.Unmarshal(line, &rec); err != nil {
+				lg.Log(lvl, string(line))
+				continue
+			}
+
+			level := lvl
+			if rec.Level != `` {
+				if parsed, err := logrus.ParseLevel(rec.Level); err == nil {
+					level = parsed
+				}
+			}
+			lg.WithFields(rec.Fields).Log(level, rec.Msg)
+		}
+
+		err := sc.Err()
+		if err == nil {
+			return
+		}
+		lg.Errorln(fmt.Sprintf("lhm: OpenForwarder: %s", err))
+		if !errors.Is(err, bufio.ErrTooLong) {
+			return
+		}
+		// an oversized line only invalidates this Scanner, not the
+		// underlying pipe: start a fresh Scanner and keep forwarding.
+	}
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
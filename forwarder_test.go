@@ -0,0 +1,104 @@
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+package lhm
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// countOpenFDs returns the number of open file descriptors of the
+// current process, via /proc. Tests using it are Linux-only.
+func countOpenFDs(t *testing.T) int {
+	t.Helper()
+	entries, err := os.ReadDir(`/proc/self/fd`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+// TestOpenForwarderReplacesExisting guards against leaking the read
+// end of a superseded forwarder's pipe (and its scanning goroutine)
+// when OpenForwarder is called again for a key that already has one,
+// e.g. after a respawned subprocess.
+func TestOpenForwarderReplacesExisting(t *testing.T) {
+	if runtime.GOOS != `linux` {
+		t.Skip(`fd-count check requires /proc`)
+	}
+
+	lm, _ := New(t.TempDir())
+	defer lm.Close()
+	if err := lm.Open(`svc`, logrus.InfoLevel); err != nil {
+		t.Fatal(err)
+	}
+
+	base := countOpenFDs(t)
+
+	var w *os.File
+	for i := 0; i < 5; i++ {
+		next, err := lm.OpenForwarder(`svc`, logrus.InfoLevel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w != nil {
+			w.Close()
+		}
+		w = next
+	}
+	w.Close()
+
+	time.Sleep(50 * time.Millisecond)
+
+	if got := countOpenFDs(t); got > base+2 {
+		t.Errorf("fd count grew from %d to %d across repeated OpenForwarder calls for the same key; superseded forwarders were not closed", base, got)
+	}
+}
+
+// TestCloseDrainsForwarder guards against Close() leaving
+// OpenForwarder's read end (and its goroutine) running forever.
+func TestCloseDrainsForwarder(t *testing.T) {
+	if runtime.GOOS != `linux` {
+		t.Skip(`fd-count check requires /proc`)
+	}
+
+	lm, _ := New(t.TempDir())
+	if err := lm.Open(`svc`, logrus.InfoLevel); err != nil {
+		t.Fatal(err)
+	}
+
+	base := countOpenFDs(t)
+
+	w, err := lm.OpenForwarder(`svc`, logrus.InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	afterOpen := countOpenFDs(t)
+	if afterOpen <= base {
+		t.Fatalf("expected OpenForwarder to open new fds, got %d -> %d", base, afterOpen)
+	}
+
+	if err := lm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Close releases two fds: the logfile and the forwarder's read
+	// end; w is still open until the deferred Close.
+	if afterClose := countOpenFDs(t); afterClose > afterOpen-2 {
+		t.Errorf("expected forwarder read end to be closed by Close(), fds before=%d after=%d", afterOpen, afterClose)
+	}
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
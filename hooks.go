@@ -0,0 +1,43 @@
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+package lhm // import "github.com/mjolnir42/lhm"
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AddHook registers h on every logger currently managed by x and on
+// every logger subsequently opened via Open/OpenWith, so operators
+// can fan all managed loggers out to syslog, journald or a network
+// collector in addition to the on-disk file.
+func (x *LogHandleMap) AddHook(h logrus.Hook) {
+	x.Lock()
+	defer x.Unlock()
+	x.hooks = append(x.hooks, h)
+	for _, lg := range x.lmap {
+		lg.AddHook(h)
+	}
+}
+
+// AddHookFor registers h on the single logger registered as key,
+// without affecting any other managed logger or loggers opened
+// afterwards. It returns an error if key is not registered.
+func (x *LogHandleMap) AddHookFor(key string, h logrus.Hook) error {
+	x.Lock()
+	defer x.Unlock()
+	lg, ok := x.lmap[key]
+	if !ok {
+		return fmt.Errorf("lhm: AddHookFor: no logger registered for key `%s`", key)
+	}
+	lg.AddHook(h)
+	return nil
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
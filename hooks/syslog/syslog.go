@@ -0,0 +1,115 @@
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+// Package syslog is a small convenience wrapper that builds a
+// logrus.Hook forwarding entries to a local or remote syslog daemon,
+// for use with LogHandleMap.AddHook/AddHookFor.
+package syslog // import "github.com/mjolnir42/lhm/hooks/syslog"
+
+import (
+	"fmt"
+	"log/syslog"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Hook forwards logrus entries to a syslog.Writer at the priority
+// selected by its level map.
+type Hook struct {
+	writer *syslog.Writer
+	levels map[logrus.Level]syslog.Priority
+}
+
+// DefaultLevelMap returns the priority each logrus.Level maps to
+// when New is not given an explicit level map.
+func DefaultLevelMap() map[logrus.Level]syslog.Priority {
+	return map[logrus.Level]syslog.Priority{
+		logrus.PanicLevel: syslog.LOG_EMERG,
+		logrus.FatalLevel: syslog.LOG_CRIT,
+		logrus.ErrorLevel: syslog.LOG_ERR,
+		logrus.WarnLevel:  syslog.LOG_WARNING,
+		logrus.InfoLevel:  syslog.LOG_INFO,
+		logrus.DebugLevel: syslog.LOG_DEBUG,
+		logrus.TraceLevel: syslog.LOG_DEBUG,
+	}
+}
+
+// New dials the syslog endpoint described by rawURL, e.g.
+// "tcp://host:514", "udp://host:514" or "unix:///dev/log", and
+// returns a logrus.Hook that forwards every entry tagged with tag at
+// the priority selected by levels. A nil levels map falls back to
+// DefaultLevelMap().
+func New(rawURL, tag string, levels map[logrus.Level]syslog.Priority) (*Hook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if levels == nil {
+		levels = DefaultLevelMap()
+	}
+
+	var w *syslog.Writer
+	switch u.Scheme {
+	case `unix`:
+		w, err = syslog.Dial(`unix`, u.Path, syslog.LOG_INFO, tag)
+	case `tcp`, `udp`:
+		w, err = syslog.Dial(u.Scheme, u.Host, syslog.LOG_INFO, tag)
+	default:
+		return nil, fmt.Errorf("lhm/hooks/syslog: unsupported scheme `%s`", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Hook{writer: w, levels: levels}, nil
+}
+
+// Levels implements logrus.Hook and fires only for the levels present
+// in the configured level map.
+func (h *Hook) Levels() []logrus.Level {
+	lv := make([]logrus.Level, 0, len(h.levels))
+	for l := range h.levels {
+		lv = append(lv, l)
+	}
+	return lv
+}
+
+// Fire implements logrus.Hook and writes entry to syslog at the
+// priority selected by the level map, falling back to LOG_INFO for
+// levels not present in it.
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	priority := syslog.LOG_INFO
+	if p, ok := h.levels[entry.Level]; ok {
+		priority = p
+	}
+
+	switch priority {
+	case syslog.LOG_EMERG:
+		return h.writer.Emerg(entry.Message)
+	case syslog.LOG_ALERT:
+		return h.writer.Alert(entry.Message)
+	case syslog.LOG_CRIT:
+		return h.writer.Crit(entry.Message)
+	case syslog.LOG_ERR:
+		return h.writer.Err(entry.Message)
+	case syslog.LOG_WARNING:
+		return h.writer.Warning(entry.Message)
+	case syslog.LOG_NOTICE:
+		return h.writer.Notice(entry.Message)
+	case syslog.LOG_DEBUG:
+		return h.writer.Debug(entry.Message)
+	default:
+		return h.writer.Info(entry.Message)
+	}
+}
+
+// Close closes the underlying syslog connection.
+func (h *Hook) Close() error {
+	return h.writer.Close()
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
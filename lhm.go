@@ -12,11 +12,9 @@ package lhm // import "github.com/mjolnir42/lhm"
 import (
 	"fmt"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/client9/reopen"
@@ -26,11 +24,21 @@ import (
 // LogHandleMap is a concurrent map that is used to look up
 // filehandles of active logfiles
 type LogHandleMap struct {
-	hmap       map[string]*reopen.FileWriter
-	lmap       map[string]*logrus.Logger
-	bp         string
-	signal     chan os.Signal
-	configured bool
+	hmap             map[string]*reopen.FileWriter
+	lmap             map[string]*logrus.Logger
+	bp               string
+	signal           chan os.Signal
+	configured       bool
+	defaultFormatter logrus.Formatter
+	pathmap          map[string]string
+	openedAt         map[string]time.Time
+	rotation         RotationPolicy
+	rotationEnabled  bool
+	rotationStop     chan struct{}
+	hooks            []logrus.Hook
+	forwarders       map[string]*forwarder
+	done             chan struct{}
+	closed           bool
 	sync.RWMutex
 }
 
@@ -40,21 +48,51 @@ func New(basepath string) (*LogHandleMap, *chan os.Signal) {
 
 	lm.hmap = make(map[string]*reopen.FileWriter)
 	lm.lmap = make(map[string]*logrus.Logger)
+	lm.pathmap = make(map[string]string)
+	lm.openedAt = make(map[string]time.Time)
 	lm.bp = basepath
 
 	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, syscall.SIGUSR2)
+	registerReopenSignal(sc)
 	lm.signal = sc
 	lm.configured = true
+	lm.rotationStop = make(chan struct{})
+	lm.done = make(chan struct{})
+	go lm.runRotationLoop()
 	return lm, &sc
 }
 
+// NewWithSignal returns an initialized LogHandleMap exactly like New,
+// except that it is triggered for reopen/rotation by sc instead of
+// registering SIGUSR2 with the OS. This lets callers wire up SIGHUP,
+// a D-Bus message or an HTTP endpoint without forking the package;
+// it is also how code that needs to run on Windows, where SIGUSR2
+// does not exist, drives Reopen.
+func NewWithSignal(basepath string, sc chan os.Signal) *LogHandleMap {
+	lm := &LogHandleMap{}
+
+	lm.hmap = make(map[string]*reopen.FileWriter)
+	lm.lmap = make(map[string]*logrus.Logger)
+	lm.pathmap = make(map[string]string)
+	lm.openedAt = make(map[string]time.Time)
+	lm.bp = basepath
+
+	lm.signal = sc
+	lm.configured = true
+	lm.rotationStop = make(chan struct{})
+	lm.done = make(chan struct{})
+	go lm.runRotationLoop()
+	return lm
+}
+
 // Init returns are barebone LogHandleMap
 func Init() *LogHandleMap {
 	lm := &LogHandleMap{}
 
 	lm.hmap = make(map[string]*reopen.FileWriter)
 	lm.lmap = make(map[string]*logrus.Logger)
+	lm.pathmap = make(map[string]string)
+	lm.openedAt = make(map[string]time.Time)
 
 	nl := logrus.New()
 	nl.Out = reopen.Stderr
@@ -84,9 +122,12 @@ func (x *LogHandleMap) Setup(basepath string) *chan os.Signal {
 
 	x.bp = basepath
 	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, syscall.SIGUSR2)
+	registerReopenSignal(sc)
 	x.signal = sc
 	x.configured = true
+	x.rotationStop = make(chan struct{})
+	x.done = make(chan struct{})
+	go x.runRotationLoop()
 	return &sc
 }
 
@@ -118,6 +159,10 @@ func (x *LogHandleMap) EarlyFatal(args ...interface{}) {
 func (x *LogHandleMap) Add(key string, fh *reopen.FileWriter, lg *logrus.Logger) {
 	x.Lock()
 	defer x.Unlock()
+	lg.AddHook(newHostPIDHook())
+	for _, h := range x.hooks {
+		lg.AddHook(h)
+	}
 	x.hmap[key] = fh
 	x.lmap[key] = lg
 }
@@ -140,19 +185,57 @@ func (x *LogHandleMap) GetLogger(key string) *logrus.Logger {
 func (x *LogHandleMap) Del(key string) {
 	x.Lock()
 	defer x.Unlock()
+	if fh, ok := x.hmap[key]; ok {
+		if err := fh.Close(); err != nil {
+			if lg, ok := x.lmap[key]; ok {
+				lg.Errorln(fmt.Sprintf("lhm: closing logfile `%s`: %s", key, err))
+			}
+		}
+	}
 	delete(x.hmap, key)
+	delete(x.pathmap, key)
+	delete(x.openedAt, key)
+	if fw, ok := x.forwarders[key]; ok {
+		fw.r.Close()
+		delete(x.forwarders, key)
+	}
 }
 
 // Open creates a new logger with registration name fname, backed by
-// fname.log at the registered basepath
+// fname.log at the registered basepath. It delegates to OpenWith
+// without forcing a Formatter, so OpenWith's own fallback applies:
+// the configured SetDefaultFormatter if one was set, otherwise the
+// historical text-formatter defaults.
 func (x *LogHandleMap) Open(fname string, lvl logrus.Level) (err error) {
+	return x.OpenWith(fname, lvl)
+}
+
+// OpenWith creates a new logger with registration name fname, backed
+// by fname.log at the registered basepath, the same way Open does,
+// but additionally accepts Option values to select a Formatter (or a
+// custom logrus.Formatter), enable ReportCaller and merge default
+// fields into every entry. Options are applied in order, so a later
+// WithCustomFormatter overrides an earlier WithFormatter.
+func (x *LogHandleMap) OpenWith(fname string, lvl logrus.Level, opts ...Option) (err error) {
 	// attempt to move existing files (includes various race conditions)
 	_ = os.Rename(
 		filepath.Join(x.bp, fname+`.log`),
 		filepath.Join(x.bp, fname+`.log.`+time.Now().UTC().Format(time.RFC3339)),
 	)
 
-	//
+	x.RLock()
+	cfg := &openConfig{formatter: x.defaultFormatter}
+	x.RUnlock()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.formatter == nil {
+		cfg.formatter = &logrus.TextFormatter{
+			DisableColors: true,
+			FullTimestamp: true,
+		}
+	}
+
 	var fh *reopen.FileWriter
 	if fh, err = reopen.NewFileWriter(
 		filepath.Join(x.bp, fname+`.log`),
@@ -161,9 +244,10 @@ func (x *LogHandleMap) Open(fname string, lvl logrus.Level) (err error) {
 	}
 	nl := logrus.New()
 	nl.Out = fh
-	nl.Formatter = &logrus.TextFormatter{
-		DisableColors: true,
-		FullTimestamp: true,
+	nl.Formatter = cfg.formatter
+	nl.ReportCaller = cfg.reportCaller
+	if len(cfg.defaultFields) > 0 {
+		nl.AddHook(&defaultFieldsHook{fields: cfg.defaultFields})
 	}
 	nl.Infoln(fmt.Sprintf("Started logfile `%s` at %s",
 		fname,
@@ -171,6 +255,10 @@ func (x *LogHandleMap) Open(fname string, lvl logrus.Level) (err error) {
 	))
 	nl.SetLevel(lvl)
 	x.Add(fname, fh, nl)
+	x.Lock()
+	x.pathmap[fname] = filepath.Join(x.bp, fname+`.log`)
+	x.openedAt[fname] = time.Now()
+	x.Unlock()
 	return
 }
 
@@ -204,42 +292,61 @@ func (x *LogHandleMap) Reopen(ignorePrefix string, abortFunc func(e error)) {
 	for {
 		select {
 		case <-x.signal:
-			locked := true
-		fileloop:
-			for name, lfHandle := range x.rangeLock() {
-				if strings.HasPrefix(name, ignorePrefix) {
-					continue
-				}
-
-				// reopen logfile handle
-				err := lfHandle.Reopen()
-
-				if err != nil {
-					x.rangeUnlock()
-					locked = false
-					abortFunc(err)
-
-					break fileloop
-				}
-
-				// get logger for associated filehandle
-				lg := x.getLoggerNolock(name)
-				// store configured filter level
-				lvl := lg.Level
-				// write out logrotate information marker
-				lg.SetLevel(logrus.InfoLevel)
-				lg.Infoln(fmt.Sprintf("Reopened logfile `%s` for logrotate at %s",
-					name,
-					time.Now().UTC().Format(time.RFC3339),
-				))
-				// restore configured filter level
-				lg.SetLevel(lvl)
-			}
-			if locked {
-				x.rangeUnlock()
+			if err := x.reopenOnce(ignorePrefix); err != nil {
+				abortFunc(err)
 			}
+		case <-x.done:
+			return
+		}
+	}
+}
+
+// ReopenNow performs exactly the work Reopen does when it receives a
+// signal, synchronously and without a goroutine: it cycles through
+// all registered logfile handles and reopens them, unless their
+// registration name starts with ignorePrefix, and returns the first
+// error encountered instead of calling an abortFunc.
+func (x *LogHandleMap) ReopenNow(ignorePrefix string) error {
+	return x.reopenOnce(ignorePrefix)
+}
+
+// reopenOnce cycles through all registered logfile handles and
+// reopens them, unless their registration name starts with
+// ignorePrefix, stopping and returning the first error encountered.
+func (x *LogHandleMap) reopenOnce(ignorePrefix string) error {
+	locked := true
+	defer func() {
+		if locked {
+			x.rangeUnlock()
 		}
+	}()
+
+	for name, lfHandle := range x.rangeLock() {
+		if strings.HasPrefix(name, ignorePrefix) {
+			continue
+		}
+
+		// reopen logfile handle
+		if err := lfHandle.Reopen(); err != nil {
+			x.rangeUnlock()
+			locked = false
+			return err
+		}
+
+		// get logger for associated filehandle
+		lg := x.getLoggerNolock(name)
+		// store configured filter level
+		lvl := lg.Level
+		// write out logrotate information marker
+		lg.SetLevel(logrus.InfoLevel)
+		lg.Infoln(fmt.Sprintf("Reopened logfile `%s` for logrotate at %s",
+			name,
+			time.Now().UTC().Format(time.RFC3339),
+		))
+		// restore configured filter level
+		lg.SetLevel(lvl)
 	}
+	return nil
 }
 
 // vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
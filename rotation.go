@@ -0,0 +1,239 @@
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+package lhm // import "github.com/mjolnir42/lhm"
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/client9/reopen"
+	"github.com/sirupsen/logrus"
+)
+
+// RotationPolicy configures the internal size/age-based rotation
+// performed by the goroutine started alongside New/Setup, as an
+// alternative to relying on an external tool such as logrotate
+// sending SIGUSR2.
+type RotationPolicy struct {
+	// MaxSizeBytes rotates a logfile once it grows past this size.
+	// Zero disables size-based rotation.
+	MaxSizeBytes int64
+	// MaxAge rotates a logfile once it is older than this duration.
+	// Zero disables age-based rotation.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated backups to keep per
+	// logfile. Zero means unlimited.
+	MaxBackups int
+	// Compress gzips rotated backups asynchronously once they have
+	// been renamed out of the way.
+	Compress bool
+	// UTCTimestamps selects UTC instead of local time for the
+	// RFC3339 suffix appended to rotated backups.
+	UTCTimestamps bool
+}
+
+// rotationCheckInterval is how often the rotation goroutine started
+// by New/Setup stats the managed logfiles.
+const rotationCheckInterval = 1 * time.Minute
+
+// EnableRotation turns on internal size/age-based rotation using
+// policy. It may be called at any time after New/Setup; the
+// rotation goroutine already running picks up the policy on its next
+// tick.
+func (x *LogHandleMap) EnableRotation(policy RotationPolicy) {
+	x.Lock()
+	defer x.Unlock()
+	x.rotation = policy
+	x.rotationEnabled = true
+}
+
+// runRotationLoop is started as a goroutine by New/Setup. It stats
+// every managed logfile on a ticker and rotates it once the
+// configured RotationPolicy thresholds are crossed. It shares the
+// rangeLock/rangeUnlock discipline with Reopen, so a SIGUSR2-driven
+// reopen and a policy-driven rotation cannot interleave on the same
+// handle.
+func (x *LogHandleMap) runRotationLoop() {
+	ticker := time.NewTicker(rotationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			x.checkRotation()
+		case <-x.rotationStop:
+			return
+		}
+	}
+}
+
+// checkRotation evaluates the RotationPolicy against every managed
+// logfile and rotates those that cross a threshold.
+func (x *LogHandleMap) checkRotation() {
+	x.RLock()
+	enabled := x.rotationEnabled
+	policy := x.rotation
+	x.RUnlock()
+	if !enabled {
+		return
+	}
+
+	for name, lfHandle := range x.rangeLock() {
+		path := x.pathmap[name]
+		if path == `` {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !dueForRotation(fi, x.openedAt[name], policy) {
+			continue
+		}
+
+		if err := x.rotateLocked(name, path, lfHandle, policy); err != nil {
+			lg := x.getLoggerNolock(name)
+			if lg != nil {
+				lg.Errorln(fmt.Sprintf("lhm: rotation of `%s` failed: %s", name, err))
+			}
+		}
+	}
+	x.rangeUnlock()
+}
+
+// dueForRotation reports whether fi crosses one of the thresholds
+// configured in policy. Age is measured from openedAt (when the
+// logfile was opened or last rotated), not fi.ModTime() — an
+// actively-logging file has its mtime refreshed on every write, so
+// mtime would never fall behind MaxAge.
+func dueForRotation(fi os.FileInfo, openedAt time.Time, policy RotationPolicy) bool {
+	if policy.MaxSizeBytes > 0 && fi.Size() >= policy.MaxSizeBytes {
+		return true
+	}
+	if policy.MaxAge > 0 && !openedAt.IsZero() && time.Since(openedAt) >= policy.MaxAge {
+		return true
+	}
+	return false
+}
+
+// rotateLocked performs the rename-then-reopen sequence used by Open
+// for logrotate-driven reopens, then prunes backups beyond
+// policy.MaxBackups and, if policy.Compress is set, gzips the backup
+// asynchronously. The caller must already hold the lock obtained via
+// rangeLock().
+func (x *LogHandleMap) rotateLocked(name, path string, lfHandle *reopen.FileWriter, policy RotationPolicy) error {
+	now := time.Now()
+	if policy.UTCTimestamps {
+		now = now.UTC()
+	}
+	backup := path + `.` + now.Format(time.RFC3339)
+
+	if err := os.Rename(path, backup); err != nil {
+		return err
+	}
+	if err := lfHandle.Reopen(); err != nil {
+		return err
+	}
+	x.openedAt[name] = now
+
+	lg := x.getLoggerNolock(name)
+	if lg != nil {
+		lvl := lg.Level
+		lg.SetLevel(logrus.InfoLevel)
+		lg.Infoln(fmt.Sprintf("rotated logfile `%s` at %s", name, now.Format(time.RFC3339)))
+		lg.SetLevel(lvl)
+	}
+
+	go pruneAndCompress(path, backup, policy)
+	return nil
+}
+
+// pruneAndCompress removes backups of path beyond policy.MaxBackups
+// and, if policy.Compress is set, gzips backup. It runs
+// asynchronously so a slow filesystem cannot stall the rotation
+// goroutine.
+func pruneAndCompress(path, backup string, policy RotationPolicy) {
+	if policy.Compress {
+		if err := gzipFile(backup); err == nil {
+			backup += `.gz`
+		}
+	}
+
+	if policy.MaxBackups <= 0 {
+		return
+	}
+
+	matches, err := listBackups(path)
+	if err != nil {
+		return
+	}
+	if len(matches) <= policy.MaxBackups {
+		return
+	}
+	sort.Strings(matches)
+	for _, stale := range matches[:len(matches)-policy.MaxBackups] {
+		_ = os.Remove(stale)
+	}
+}
+
+// listBackups returns the rotated backups of path, oldest first by
+// name (the RFC3339 suffix sorts chronologically as a string).
+func listBackups(path string) ([]string, error) {
+	dir := filepath.Dir(path)
+	base := filepath.Base(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if e.Name() != base && strings.HasPrefix(e.Name(), base+`.`) {
+			matches = append(matches, filepath.Join(dir, e.Name()))
+		}
+	}
+	return matches, nil
+}
+
+// gzipFile compresses src in place as src+".gz" and removes src.
+func gzipFile(src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(src + `.gz`)
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(out)
+	if _, err := io.Copy(gw, in); err != nil {
+		gw.Close()
+		out.Close()
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
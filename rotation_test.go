@@ -0,0 +1,63 @@
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+package lhm
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDueForRotationSize(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), `rotation`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`0123456789`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !dueForRotation(fi, time.Now(), RotationPolicy{MaxSizeBytes: 5}) {
+		t.Error("expected rotation due to size threshold")
+	}
+	if dueForRotation(fi, time.Now(), RotationPolicy{MaxSizeBytes: 100}) {
+		t.Error("did not expect rotation: size below threshold")
+	}
+}
+
+// TestDueForRotationAge guards against regressing to fi.ModTime(),
+// which is refreshed on every write and so never falls behind
+// MaxAge for an actively-logging file.
+func TestDueForRotationAge(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), `rotation`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openedAt := time.Now().Add(-1 * time.Hour)
+	if !dueForRotation(fi, openedAt, RotationPolicy{MaxAge: time.Minute}) {
+		t.Error("expected rotation due to age threshold tracked from openedAt")
+	}
+	if dueForRotation(fi, openedAt, RotationPolicy{MaxAge: 24 * time.Hour}) {
+		t.Error("did not expect rotation: age below threshold")
+	}
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
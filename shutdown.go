@@ -0,0 +1,72 @@
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+package lhm // import "github.com/mjolnir42/lhm"
+
+import (
+	"errors"
+	"fmt"
+	"os/signal"
+	"time"
+
+	"github.com/client9/reopen"
+	"github.com/sirupsen/logrus"
+)
+
+// Close tears down x: it stops the Reopen goroutine and the
+// rotation goroutine started alongside New/Setup, undoes the
+// registered signal.Notify (if any), writes a final "closing
+// logfile" marker through every managed logger, closes every
+// *reopen.FileWriter it owns, and closes the read end of every
+// pipe opened via OpenForwarder so the forwarding goroutines drain
+// and exit. Errors encountered while closing individual filehandles
+// are aggregated with errors.Join. Close is safe to call more than
+// once.
+func (x *LogHandleMap) Close() error {
+	x.Lock()
+	defer x.Unlock()
+
+	if x.closed {
+		return nil
+	}
+	x.closed = true
+
+	if x.signal != nil {
+		signal.Stop(x.signal)
+	}
+	if x.done != nil {
+		close(x.done)
+	}
+	if x.rotationStop != nil {
+		close(x.rotationStop)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for name, lg := range x.lmap {
+		lvl := lg.Level
+		lg.SetLevel(logrus.InfoLevel)
+		lg.Infoln(fmt.Sprintf("closing logfile `%s` at %s", name, now))
+		lg.SetLevel(lvl)
+	}
+
+	var errs []error
+	for name, fh := range x.hmap {
+		if err := fh.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("lhm: closing `%s`: %w", name, err))
+		}
+	}
+	x.hmap = make(map[string]*reopen.FileWriter)
+
+	for key, fw := range x.forwarders {
+		fw.r.Close()
+		delete(x.forwarders, key)
+	}
+
+	return errors.Join(errs...)
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
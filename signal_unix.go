@@ -0,0 +1,24 @@
+//go:build !windows
+
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+package lhm // import "github.com/mjolnir42/lhm"
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// registerReopenSignal registers SIGUSR2 on sc, the historical
+// logrotate-driven reopen trigger.
+func registerReopenSignal(sc chan os.Signal) {
+	signal.Notify(sc, syscall.SIGUSR2)
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix
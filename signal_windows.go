@@ -0,0 +1,22 @@
+//go:build windows
+
+/*-
+ * Copyright (c) 2020, Jörg Pernfuß
+ *
+ * Use of this source code is governed by a 2-clause BSD license
+ * that can be found in the LICENSE file.
+ */
+
+package lhm // import "github.com/mjolnir42/lhm"
+
+import (
+	"os"
+)
+
+// registerReopenSignal is a no-op on Windows, which has no SIGUSR2.
+// Reopen is instead driven programmatically via ReopenNow or a
+// caller-supplied channel passed to NewWithSignal.
+func registerReopenSignal(sc chan os.Signal) {
+}
+
+// vim: ts=4 sw=4 sts=4 noet fenc=utf-8 ffs=unix